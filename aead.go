@@ -0,0 +1,114 @@
+package spritz
+
+// ---------------------------------------
+// Expose spritz as a standard crypto/cipher.AEAD.
+// ---------------------------------------
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"fmt"
+)
+
+// AEADNonceSize is the nonce length required by the AEAD returned from
+// NewAEAD. A nonce must never be reused with the same key.
+const AEADNonceSize = 16
+
+type aead struct {
+	key []byte
+}
+
+// NewAEAD returns a cipher.AEAD backed by Spritz. Each Seal/Open
+// initializes a fresh Spritz state per purpose by absorbing the key, the
+// nonce, and the additional data: one state drips the keystream that
+// XORs the plaintext, and a separate state absorbs the ciphertext and
+// drips a tagSize-byte MAC from it.
+func NewAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("spritz: NewAEAD requires a non-empty key")
+	}
+	return &aead{key: append([]byte(nil), key...)}, nil
+}
+
+func (a *aead) NonceSize() int { return AEADNonceSize }
+func (a *aead) Overhead() int  { return tagSize }
+
+func (a *aead) newState(nonce, additionalData []byte, purpose byte) *state {
+	s := new(state)
+	initialize(s)
+	absorbMany(s, a.key)
+	absorbStop(s)
+	absorbMany(s, nonce)
+	if len(additionalData) > 0 {
+		absorbMany(s, additionalData)
+	}
+	absorbStop(s)
+	absorbMany(s, []byte{purpose})
+	absorbStop(s)
+	return s
+}
+
+// Seal implements cipher.AEAD.
+func (a *aead) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != a.NonceSize() {
+		panic("spritz: bad nonce length passed to Seal")
+	}
+
+	ret, out := sliceForAppend(dst, len(plaintext)+a.Overhead())
+	ct, tagOut := out[:len(plaintext)], out[len(plaintext):]
+
+	enc := a.newState(nonce, additionalData, purposeEncrypt)
+	enc.XORKeyStream(ct, plaintext)
+
+	mac := a.newState(nonce, additionalData, purposeTag)
+	absorbMany(mac, ct)
+	absorbStop(mac)
+	dripMany(mac, tagOut)
+
+	return ret
+}
+
+// Open implements cipher.AEAD.
+func (a *aead) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != a.NonceSize() {
+		panic("spritz: bad nonce length passed to Open")
+	}
+	if len(ciphertext) < a.Overhead() {
+		return nil, fmt.Errorf("spritz: ciphertext too short")
+	}
+
+	ct := ciphertext[:len(ciphertext)-a.Overhead()]
+	tag := ciphertext[len(ciphertext)-a.Overhead():]
+
+	mac := a.newState(nonce, additionalData, purposeTag)
+	absorbMany(mac, ct)
+	absorbStop(mac)
+	wantTag := make([]byte, a.Overhead())
+	dripMany(mac, wantTag)
+
+	if subtle.ConstantTimeCompare(wantTag, tag) != 1 {
+		return nil, fmt.Errorf("spritz: message authentication failed")
+	}
+
+	dec := a.newState(nonce, additionalData, purposeEncrypt)
+	pt := make([]byte, len(ct))
+	dec.XORKeyStream(pt, ct)
+
+	ret, out := sliceForAppend(dst, len(pt))
+	copy(out, pt)
+	return ret, nil
+}
+
+// sliceForAppend extends dst, as needed, to hold n more bytes, following
+// the convention used by the standard library's AEAD implementations.
+func sliceForAppend(dst []byte, n int) (head, tail []byte) {
+	total := len(dst) + n
+	if cap(dst) >= total {
+		head = dst[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, dst)
+	}
+	tail = head[len(dst):]
+	return
+}
@@ -0,0 +1,56 @@
+package spritz
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAEADSealOpenRoundTrip(t *testing.T) {
+	a, err := NewAEAD([]byte("a reasonably long aead key"))
+	if err != nil {
+		t.Fatalf("NewAEAD: %v", err)
+	}
+
+	nonce := make([]byte, a.NonceSize())
+	plaintext := []byte("attack at dawn")
+	ad := []byte("header metadata")
+
+	ct := a.Seal(nil, nonce, plaintext, ad)
+
+	pt, err := a.Open(nil, nonce, ct, ad)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if !bytes.Equal(pt, plaintext) {
+		t.Fatalf("got plaintext %q, want %q", pt, plaintext)
+	}
+}
+
+func TestAEADOpenDetectsTamperedCiphertext(t *testing.T) {
+	a, err := NewAEAD([]byte("a reasonably long aead key"))
+	if err != nil {
+		t.Fatalf("NewAEAD: %v", err)
+	}
+
+	nonce := make([]byte, a.NonceSize())
+	ct := a.Seal(nil, nonce, []byte("attack at dawn"), nil)
+	ct[0] ^= 0xff
+
+	if _, err := a.Open(nil, nonce, ct, nil); err == nil {
+		t.Fatal("expected an authentication error for tampered ciphertext, got nil")
+	}
+}
+
+func TestAEADOpenDetectsTamperedAdditionalData(t *testing.T) {
+	a, err := NewAEAD([]byte("a reasonably long aead key"))
+	if err != nil {
+		t.Fatalf("NewAEAD: %v", err)
+	}
+
+	nonce := make([]byte, a.NonceSize())
+	ct := a.Seal(nil, nonce, []byte("attack at dawn"), []byte("original header"))
+
+	if _, err := a.Open(nil, nonce, ct, []byte("swapped header")); err == nil {
+		t.Fatal("expected an authentication error for mismatched additional data, got nil")
+	}
+}
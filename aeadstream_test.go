@@ -0,0 +1,168 @@
+package spritz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestAEADStreamRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := WrapAEADWriter(&buf, "correct horse battery staple", "secret.txt")
+	if err != nil {
+		t.Fatalf("WrapAEADWriter: %v", err)
+	}
+
+	plaintext := []byte("the quick brown fox jumps over the lazy dog")
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	r, fn, err := WrapAEADReader(bytes.NewReader(buf.Bytes()), "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("WrapAEADReader: %v", err)
+	}
+	if fn != "secret.txt" {
+		t.Fatalf("got filename %q, want %q", fn, "secret.txt")
+	}
+
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading plaintext: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("got plaintext %q, want %q", got, plaintext)
+	}
+}
+
+// TestAEADStreamWrongPassword decrypts with the wrong password and expects
+// an error somewhere in the process. The header carries only a 32-bit
+// password-looks-right check (the same one WrapWriter/readHeader have
+// always used), so it is WrapAEADReader's chunk authentication -- not
+// necessarily the header check -- that is guaranteed to catch a wrong
+// password, since a wrong password also means a wrong file key and thus a
+// failing per-chunk tag.
+func TestAEADStreamWrongPassword(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := WrapAEADWriter(&buf, "right password", "")
+	if err != nil {
+		t.Fatalf("WrapAEADWriter: %v", err)
+	}
+	if _, err := w.Write([]byte("sensitive stuff")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	r, _, err := WrapAEADReader(bytes.NewReader(buf.Bytes()), "wrong password")
+	if err != nil {
+		return
+	}
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Fatal("expected an error decrypting with the wrong password, got nil")
+	}
+}
+
+// TestAEADStreamTamperDetected mutates one byte in the middle of an
+// encrypted file (spanning several chunks) and confirms decryption
+// returns an error instead of corrupted plaintext.
+func TestAEADStreamTamperDetected(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := WrapAEADWriter(&buf, "hunter2", "")
+	if err != nil {
+		t.Fatalf("WrapAEADWriter: %v", err)
+	}
+
+	plaintext := bytes.Repeat([]byte("spritz is an rc4-like stream cipher. "), 4000) // > one chunk
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data := buf.Bytes()
+	data[len(data)/2] ^= 0xff
+
+	r, _, err := WrapAEADReader(bytes.NewReader(data), "hunter2")
+	if err != nil {
+		t.Fatalf("WrapAEADReader: %v", err)
+	}
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Fatal("expected an authentication error after mutating one byte, got nil")
+	}
+}
+
+// TestAEADStreamTruncationDetected drops the final (last-flagged) chunk
+// of an otherwise valid file and confirms the reader errors rather than
+// silently accepting a shortened plaintext.
+func TestAEADStreamTruncationDetected(t *testing.T) {
+	key := make([]byte, fileKeySize)
+	for i := range key {
+		key[i] = byte(i)
+	}
+
+	const chunkSize = 8
+	var buf bytes.Buffer
+	w := &aeadWriter{w: &buf, key: key, chunkSize: chunkSize}
+
+	plaintext := bytes.Repeat([]byte("abcdefgh"), 3) // exactly 3 full chunks
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// drop the final, empty, last-flagged chunk the writer appended on Close
+	truncated := buf.Bytes()[:3*(chunkSize+tagSize)]
+
+	r := newAEADReader(bytes.NewReader(truncated), key, chunkSize)
+	got, err := ioutil.ReadAll(r)
+	if err == nil {
+		t.Fatalf("expected a truncation error, got plaintext %q", got)
+	}
+}
+
+func TestAEADStreamChunkBoundaries(t *testing.T) {
+	key := make([]byte, fileKeySize)
+	for i := range key {
+		key[i] = byte(i * 7)
+	}
+
+	const chunkSize = 8
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"exact multiple of chunk size", bytes.Repeat([]byte("abcdefgh"), 3)},
+		{"partial final chunk", append(bytes.Repeat([]byte("abcdefgh"), 2), []byte("xyz")...)},
+		{"empty", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := &aeadWriter{w: &buf, key: key, chunkSize: chunkSize}
+			if _, err := w.Write(c.data); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			r := newAEADReader(bytes.NewReader(buf.Bytes()), key, chunkSize)
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("reading plaintext: %v", err)
+			}
+			if !bytes.Equal(got, c.data) {
+				t.Fatalf("got plaintext %q, want %q", got, c.data)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package spritz
+
+// ---------------------------------------
+// An ASCII-armor wrapper for spritz encrypted streams: base64 body
+// lines framed with PEM/OpenPGP-style BEGIN/END markers and a trailing
+// CRC-24 checksum, so ciphertext can be pasted into email or chat.
+// ---------------------------------------
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	armorBeginLine = "-----BEGIN SPRITZ ENCRYPTED FILE-----"
+	armorEndLine   = "-----END SPRITZ ENCRYPTED FILE-----"
+	armorLineWidth = 64
+)
+
+// crc24Init and crc24Poly are the CRC-24 parameters used by OpenPGP
+// armor (RFC 4880 section 6.1): init 0xB704CE, poly 0x1864CFB.
+const (
+	crc24Init = 0xB704CE
+	crc24Poly = 0x1864CFB
+)
+
+func updateCRC24(crc *uint32, data []byte) {
+	c := *crc
+	for _, b := range data {
+		c ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			c <<= 1
+			if c&0x1000000 != 0 {
+				c ^= crc24Poly
+			}
+		}
+	}
+	*crc = c & 0xFFFFFF
+}
+
+// armorWriter base64-encodes everything written to it, wraps it at
+// armorLineWidth columns, and frames it with BEGIN/END markers and a
+// CRC-24 checksum line once Close is called.
+type armorWriter struct {
+	w       io.Writer
+	raw     []byte // buffered raw bytes, always fewer than 3
+	line    []byte // buffered encoded chars, always fewer than armorLineWidth
+	crc     uint32
+	started bool
+	closed  bool
+	err     error
+}
+
+// NewArmorWriter wraps w so that everything written to it is emitted as
+// an ASCII-armored envelope. The caller must Close the returned writer
+// to flush the final partial line, the checksum, and the END marker.
+func NewArmorWriter(w io.Writer) io.WriteCloser {
+	return &armorWriter{w: w, crc: crc24Init}
+}
+
+func (a *armorWriter) Write(p []byte) (int, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+	if a.closed {
+		return 0, fmt.Errorf("spritz: write to closed armor writer")
+	}
+	if !a.started {
+		a.started = true
+		if _, err := io.WriteString(a.w, armorBeginLine+"\n"); err != nil {
+			a.err = err
+			return 0, err
+		}
+	}
+
+	updateCRC24(&a.crc, p)
+
+	a.raw = append(a.raw, p...)
+	if whole := len(a.raw) - len(a.raw)%3; whole > 0 {
+		a.line = append(a.line, base64.StdEncoding.EncodeToString(a.raw[:whole])...)
+		a.raw = append([]byte(nil), a.raw[whole:]...)
+		if err := a.flushLines(false); err != nil {
+			a.err = err
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (a *armorWriter) flushLines(all bool) error {
+	for len(a.line) >= armorLineWidth {
+		if _, err := fmt.Fprintln(a.w, string(a.line[:armorLineWidth])); err != nil {
+			return err
+		}
+		a.line = a.line[armorLineWidth:]
+	}
+	if all && len(a.line) > 0 {
+		if _, err := fmt.Fprintln(a.w, string(a.line)); err != nil {
+			return err
+		}
+		a.line = nil
+	}
+	return nil
+}
+
+// Close flushes any buffered bytes, then writes the checksum and END
+// marker lines.
+func (a *armorWriter) Close() error {
+	if a.closed {
+		return a.err
+	}
+	a.closed = true
+	if a.err != nil {
+		return a.err
+	}
+	if !a.started {
+		a.started = true
+		if _, err := io.WriteString(a.w, armorBeginLine+"\n"); err != nil {
+			return err
+		}
+	}
+	if len(a.raw) > 0 {
+		a.line = append(a.line, base64.StdEncoding.EncodeToString(a.raw)...)
+		a.raw = nil
+	}
+	if err := a.flushLines(true); err != nil {
+		return err
+	}
+
+	crcBytes := []byte{byte(a.crc >> 16), byte(a.crc >> 8), byte(a.crc)}
+	if _, err := fmt.Fprintf(a.w, "=%s\n", base64.StdEncoding.EncodeToString(crcBytes)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(a.w, armorEndLine+"\n")
+	return err
+}
+
+// armorReader parses an armored envelope on first Read, then serves the
+// decoded bytes from memory.
+type armorReader struct {
+	br   *bufio.Reader
+	buf  []byte
+	pos  int
+	init bool
+	err  error
+}
+
+// NewArmorReader wraps r so that Read transparently strips an ASCII
+// armor envelope, if one is present. Leading whitespace and CRLF line
+// endings are tolerated. If no armor BEGIN marker is found, r's bytes
+// are passed through unchanged.
+func NewArmorReader(r io.Reader) io.Reader {
+	br := bufio.NewReaderSize(r, 8192)
+	peek, _ := br.Peek(512)
+	if !bytes.HasPrefix(bytes.TrimLeft(peek, " \t\r\n"), []byte(armorBeginLine)) {
+		return br
+	}
+	return &armorReader{br: br}
+}
+
+func (a *armorReader) Read(p []byte) (int, error) {
+	if !a.init {
+		a.init = true
+		a.err = a.parse()
+	}
+	if a.pos >= len(a.buf) {
+		if a.err != nil {
+			return 0, a.err
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, a.buf[a.pos:])
+	a.pos += n
+	return n, nil
+}
+
+func (a *armorReader) parse() error {
+	for {
+		line, err := a.br.ReadString('\n')
+		trimmed := strings.TrimSpace(line)
+		if trimmed == armorBeginLine {
+			break
+		}
+		if trimmed != "" {
+			return fmt.Errorf("spritz: malformed armor header")
+		}
+		if err != nil {
+			return fmt.Errorf("spritz: armor BEGIN marker not found")
+		}
+	}
+
+	var body strings.Builder
+	var crcLine string
+	for {
+		line, err := a.br.ReadString('\n')
+		trimmed := strings.TrimRight(strings.TrimRight(line, "\n"), "\r")
+		if strings.HasPrefix(trimmed, "=") {
+			crcLine = trimmed
+			break
+		}
+		body.WriteString(trimmed)
+		if err != nil {
+			return fmt.Errorf("spritz: armor body truncated before checksum")
+		}
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(body.String())
+	if err != nil {
+		return fmt.Errorf("spritz: bad armor body encoding: %w", err)
+	}
+
+	crcBytes, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(crcLine, "="))
+	if err != nil || len(crcBytes) != 3 {
+		return fmt.Errorf("spritz: bad armor checksum encoding")
+	}
+	wantCRC := uint32(crcBytes[0])<<16 | uint32(crcBytes[1])<<8 | uint32(crcBytes[2])
+
+	gotCRC := uint32(crc24Init)
+	updateCRC24(&gotCRC, raw)
+	if gotCRC != wantCRC {
+		return fmt.Errorf("spritz: armor checksum mismatch")
+	}
+
+	for {
+		line, err := a.br.ReadString('\n')
+		if strings.HasPrefix(strings.TrimSpace(line), "-----END") || err != nil {
+			break
+		}
+	}
+
+	a.buf = raw
+	return nil
+}
@@ -0,0 +1,67 @@
+package spritz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestArmorRoundTrip(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("spritz is an rc4-like stream cipher. "), 200) // spans several lines
+
+	var armored bytes.Buffer
+	w := NewArmorWriter(&armored)
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got, err := ioutil.ReadAll(NewArmorReader(bytes.NewReader(armored.Bytes())))
+	if err != nil {
+		t.Fatalf("reading armored data: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("got %q, want %q", got, plaintext)
+	}
+}
+
+func TestArmorRoundTripCRLF(t *testing.T) {
+	plaintext := []byte("short message")
+
+	var armored bytes.Buffer
+	w := NewArmorWriter(&armored)
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	crlf := strings.ReplaceAll(armored.String(), "\n", "\r\n")
+
+	got, err := ioutil.ReadAll(NewArmorReader(strings.NewReader(crlf)))
+	if err != nil {
+		t.Fatalf("reading CRLF-armored data: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("got %q, want %q", got, plaintext)
+	}
+}
+
+// TestArmorPassthroughWithoutHeader confirms NewArmorReader passes bytes
+// through unchanged when no BEGIN marker is present, rather than failing
+// or mangling un-armored ciphertext.
+func TestArmorPassthroughWithoutHeader(t *testing.T) {
+	raw := []byte("not armored at all, just some opaque bytes \x00\x01\x02")
+
+	got, err := ioutil.ReadAll(NewArmorReader(bytes.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("reading passthrough data: %v", err)
+	}
+	if !bytes.Equal(got, raw) {
+		t.Fatalf("got %q, want %q", got, raw)
+	}
+}
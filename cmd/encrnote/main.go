@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -9,6 +12,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/rwtodd/apputil-go/resource"
 	"github.com/rwtodd/spritz-go"
@@ -16,12 +21,51 @@ import (
 
 var port = flag.String("port", "8000", "serve pages on this localhost port")
 var fname = flag.String("input", "", "use the given input file")
+var armor = flag.Bool("armor", false, "have /save also return ascii-armored ciphertext for copy/paste")
+var idleTimeout = flag.Duration("idle-timeout", 15*time.Minute, "zero the stored password after this much inactivity")
 var help bool
-var pw string // the password of the loaded file
 
 // rscBase is the base path of our resources (static files, etc...)
 var rscBase string
 
+// session tracks the one browser tab currently allowed to save: its
+// token (handed to the client on a successful /load), the password it
+// loaded with, and when it was last heard from. A second successful
+// /load displaces whatever session was active, the way a new websocket
+// log-tail connection displaces the previous "actor" in cloudflared.
+type session struct {
+	token        string
+	pw           string
+	lastActivity time.Time
+}
+
+var (
+	sessMu  sync.Mutex
+	current *session
+)
+
+// newSessionToken returns a random, URL-safe session token.
+func newSessionToken() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// activeSession returns the current session, or nil if there isn't one
+// or it has gone idle past *idleTimeout (in which case its password is
+// zeroed out as a side effect). Callers must not hold sessMu.
+func activeSession() *session {
+	sessMu.Lock()
+	defer sessMu.Unlock()
+	if current != nil && time.Since(current.lastActivity) > *idleTimeout {
+		current.pw = ""
+		current = nil
+	}
+	return current
+}
+
 func main() {
 	var err error
 	flag.BoolVar(&help, "help", false, "print this usage information")
@@ -48,6 +92,7 @@ func main() {
 	http.HandleFunc("/encr.css", cssHandler)
 	http.HandleFunc("/load", loadHandler)
 	http.HandleFunc("/save", saveHandler)
+	http.HandleFunc("/whoami", whoamiHandler)
 
 	if err = http.ListenAndServe("localhost:"+*port, nil); err != nil {
 		log.Fatal(err)
@@ -66,17 +111,17 @@ type response struct {
 	OK          bool
 	Text        string
 	ErrorDetail string
+	Session     string `json:",omitempty"`
 }
 
 func writeErr(err error, w http.ResponseWriter) {
-	respjson, _ := json.Marshal(&response{false, "", err.Error()})
+	respjson, _ := json.Marshal(&response{OK: false, ErrorDetail: err.Error()})
 	w.Write(respjson)
 	log.Print(err)
 }
 
 func loadHandler(w http.ResponseWriter, r *http.Request) {
 	log.Print("LOAD")
-	pw = "" // only set the global pw on success
 
 	pwbytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -92,7 +137,8 @@ func loadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer src.Close()
 
-	decrypted, _, err := spritz.WrapReader(src, locpw)
+	// transparently accept either a raw or an ascii-armored file
+	decrypted, _, err := spritz.WrapReader(spritz.NewArmorReader(src), locpw)
 	if err != nil {
 		writeErr(err, w)
 		return
@@ -104,22 +150,77 @@ func loadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respjson, err := json.Marshal(&response{true, string(docbytes), ""})
+	token, err := newSessionToken()
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+
+	respjson, err := json.Marshal(&response{OK: true, Text: string(docbytes), Session: token})
 	if err != nil {
 		writeErr(err, w)
 		return
 	}
 
-	pw = locpw // all ok, save the pw
+	// all ok: displace whatever session was active and start a new one
+	sessMu.Lock()
+	if current != nil {
+		current.pw = ""
+	}
+	current = &session{token: token, pw: locpw, lastActivity: time.Now()}
+	sessMu.Unlock()
+
+	w.Write(respjson)
+}
+
+func whoamiHandler(w http.ResponseWriter, r *http.Request) {
+	sess := activeSession()
+	active := sess != nil && sess.token == r.Header.Get("X-Session") && sess.token != ""
+
+	respjson, err := json.Marshal(&struct {
+		Active bool `json:"active"`
+	}{active})
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
 	w.Write(respjson)
 }
 
 func saveHandler(w http.ResponseWriter, r *http.Request) {
 	log.Print("SAVE")
-	if len(pw) == 0 {
+
+	token := r.Header.Get("X-Session")
+	if token == "" {
+		if c, err := r.Cookie("spritz-session"); err == nil {
+			token = c.Value
+		}
+	}
+
+	// Validate the session and read its password in one locked section:
+	// checking current against a previously-fetched *session and then
+	// re-locking to read its pw leaves a window where a concurrent /load
+	// can displace current (zeroing the very struct we still hold a
+	// pointer to) in between, so we'd go on to encrypt with an
+	// already-blanked password instead of failing the save.
+	sessMu.Lock()
+	if current != nil && time.Since(current.lastActivity) > *idleTimeout {
+		current.pw = ""
+		current = nil
+	}
+	if current == nil {
+		sessMu.Unlock()
 		writeErr(fmt.Errorf("File not properly loaded"), w)
 		return
 	}
+	if token == "" || token != current.token {
+		sessMu.Unlock()
+		writeErr(fmt.Errorf("no active session for this tab: reload the file first"), w)
+		return
+	}
+	current.lastActivity = time.Now()
+	pw := current.pw
+	sessMu.Unlock()
 
 	docbytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -127,6 +228,17 @@ func saveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var encrypted bytes.Buffer
+	writer, err := spritz.WrapWriter(&encrypted, pw, "")
+	if err != nil {
+		writeErr(err, w)
+		return
+	}
+	if _, err = writer.Write(docbytes); err != nil {
+		writeErr(err, w)
+		return
+	}
+
 	if err = os.Rename(*fname, (*fname)+".bak"); err != nil {
 		writeErr(err, w)
 		return
@@ -139,18 +251,26 @@ func saveHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer outFile.Close()
 
-	writer, err := spritz.WrapWriter(outFile, pw, "")
-	if err != nil {
+	if _, err = outFile.Write(encrypted.Bytes()); err != nil {
 		writeErr(err, w)
 		return
 	}
 
-	if _, err = writer.Write(docbytes); err != nil {
-		writeErr(err, w)
-		return
+	var armoredText string
+	if *armor || r.Header.Get("X-Armor") == "true" {
+		var armored bytes.Buffer
+		aw := spritz.NewArmorWriter(&armored)
+		if _, err = aw.Write(encrypted.Bytes()); err == nil {
+			err = aw.Close()
+		}
+		if err != nil {
+			writeErr(err, w)
+			return
+		}
+		armoredText = armored.String()
 	}
 
-	respjson, err := json.Marshal(&response{true, "", ""})
+	respjson, err := json.Marshal(&response{OK: true, Text: armoredText})
 	if err != nil {
 		writeErr(err, w)
 		return
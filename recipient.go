@@ -0,0 +1,291 @@
+package spritz
+
+// ---------------------------------------
+// Recipient/Identity abstraction, plus a multi-recipient container
+// format (EncryptTo/DecryptWith) built on top of it.
+//
+// WrapWriter/WrapReader only ever encrypt to a single password, and their
+// wire format has no room for more than one wrapped key, so
+// EncryptTo/DecryptWith introduce their own container (containerMagic,
+// stanzas, a header MAC) in front of the same authenticated, chunked
+// payload (see aeadstream.go). Recipient and Identity let that container
+// be sealed to any number of recipients at once (passwords, public
+// keys, ...): EncryptTo generates a random file key, asks each Recipient
+// to wrap it into a Stanza, and writes those stanzas into the header
+// ahead of the payload. DecryptWith tries each Identity against each
+// stanza until one recovers the file key.
+// ---------------------------------------
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// containerMagic identifies the multi-recipient container format. It is
+// written as a line of its own ahead of any recipient stanzas.
+const containerMagic = "spritz-encryption v1"
+
+// nameStanzaType tags the stanza that carries the encrypted original
+// filename. It is framed exactly like any other Stanza (and so is folded
+// into headerMAC along with the recipient stanzas), but no Identity
+// claims its type, so it's simply skipped over when DecryptWith tries
+// identities against stanzas.
+const nameStanzaType = "name"
+
+// Stanza is one recipient-wrapped file key within a multi-recipient
+// header: a type tag, zero or more string arguments specific to that
+// type (a salt, a work factor, an ephemeral public key, ...), and an
+// opaque body holding the wrapped key material.
+type Stanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+// Recipient wraps a randomly generated file key so that only a matching
+// Identity can recover it.
+type Recipient interface {
+	WrapFileKey(fileKey []byte) (Stanza, error)
+}
+
+// Identity attempts to recover a file key from a Stanza. It must return
+// an error for any stanza it does not recognize or cannot unwrap, so
+// DecryptWith can move on to the next identity/stanza pair; a wrong
+// password or key should likewise be caught later by the header MAC
+// check rather than by UnwrapStanza itself succeeding or failing.
+type Identity interface {
+	UnwrapStanza(st Stanza) (fileKey []byte, err error)
+}
+
+// EncryptTo wraps sink with an encrypting stream sealed to every given
+// recipient: a random file key is generated, wrapped once per recipient,
+// and the resulting stanzas -- plus one more carrying the filename,
+// encrypted under the file key -- are written ahead of a MAC over the
+// whole header (keyed by the file key) and an authenticated, chunked
+// payload (see WrapAEADWriter). Any identity matching any one recipient
+// can later decrypt the file with DecryptWith.
+func EncryptTo(sink io.Writer, origfn string, recipients ...Recipient) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("spritz: at least one recipient is required")
+	}
+
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+
+	var hdr bytes.Buffer
+	fmt.Fprintln(&hdr, containerMagic)
+	for _, r := range recipients {
+		st, err := r.WrapFileKey(fileKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeStanza(&hdr, st); err != nil {
+			return nil, err
+		}
+	}
+
+	namebytes := append([]byte{byte(len(origfn))}, []byte(origfn)...)
+	encName := make([]byte, len(namebytes))
+	nameSubkey(fileKey).XORKeyStream(encName, namebytes)
+	if err := writeStanza(&hdr, Stanza{Type: nameStanzaType, Body: encName}); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&hdr, "--- %s\n", base64.StdEncoding.EncodeToString(headerMAC(fileKey, hdr.Bytes())))
+
+	if _, err := sink.Write(hdr.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return &aeadWriter{w: sink, key: fileKey, chunkSize: DefaultChunkSize}, nil
+}
+
+// DecryptWith wraps src with a decrypting stream, trying each identity
+// against each header stanza until one of them yields a file key whose
+// header MAC checks out. The payload is read with the same chunk
+// authentication as WrapAEADReader.
+func DecryptWith(src io.Reader, identities ...Identity) (io.Reader, string, error) {
+	if len(identities) == 0 {
+		return nil, "", fmt.Errorf("spritz: at least one identity is required")
+	}
+
+	br := bufio.NewReader(src)
+	magic, err := br.ReadString('\n')
+	if err != nil || strings.TrimSuffix(magic, "\n") != containerMagic {
+		return nil, "", fmt.Errorf("spritz: not a multi-recipient spritz file")
+	}
+
+	var hdr bytes.Buffer
+	hdr.WriteString(magic)
+
+	var stanzas []Stanza
+	var macB64 string
+	for {
+		peeked, err := br.Peek(4)
+		if err == nil && string(peeked) == "--- " {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return nil, "", err
+			}
+			macB64 = strings.TrimSuffix(strings.TrimPrefix(line, "--- "), "\n")
+			break
+		}
+		st, raw, err := readStanza(br)
+		if err != nil {
+			return nil, "", fmt.Errorf("spritz: malformed recipient header: %w", err)
+		}
+		hdr.Write(raw)
+		stanzas = append(stanzas, st)
+	}
+
+	wantMAC, err := base64.StdEncoding.DecodeString(macB64)
+	if err != nil {
+		return nil, "", fmt.Errorf("spritz: bad header MAC encoding")
+	}
+
+	var fileKey []byte
+findKey:
+	for _, id := range identities {
+		for _, st := range stanzas {
+			fk, err := id.UnwrapStanza(st)
+			if err != nil {
+				continue
+			}
+			if subtle.ConstantTimeCompare(headerMAC(fk, hdr.Bytes()), wantMAC) == 1 {
+				fileKey = fk
+				break findKey
+			}
+		}
+	}
+	if fileKey == nil {
+		return nil, "", fmt.Errorf("spritz: no identity could unwrap the file key")
+	}
+
+	fn, err := decryptNameStanza(fileKey, stanzas)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return newAEADReader(br, fileKey, DefaultChunkSize), fn, nil
+}
+
+// decryptNameStanza finds the stanza EncryptTo wrote to carry the
+// encrypted filename and decrypts it under fileKey. Its authenticity was
+// already established: it is one of the stanzas folded into the header
+// bytes headerMAC just verified.
+func decryptNameStanza(fileKey []byte, stanzas []Stanza) (string, error) {
+	for _, st := range stanzas {
+		if st.Type != nameStanzaType {
+			continue
+		}
+		namebytes := make([]byte, len(st.Body))
+		nameSubkey(fileKey).XORKeyStream(namebytes, st.Body)
+		if len(namebytes) < 1 || int(namebytes[0]) != len(namebytes)-1 {
+			return "", fmt.Errorf("spritz: malformed encrypted filename")
+		}
+		return string(namebytes[1:]), nil
+	}
+	return "", nil
+}
+
+// writeStanza writes st as a "-> type args...\n" line followed by its
+// base64-encoded body, wrapped at 64 columns.
+func writeStanza(w io.Writer, st Stanza) error {
+	fields := append([]string{"->", st.Type}, st.Args...)
+	if _, err := fmt.Fprintln(w, strings.Join(fields, " ")); err != nil {
+		return err
+	}
+	enc := base64.StdEncoding.EncodeToString(st.Body)
+	for len(enc) > 64 {
+		if _, err := fmt.Fprintln(w, enc[:64]); err != nil {
+			return err
+		}
+		enc = enc[64:]
+	}
+	_, err := fmt.Fprintln(w, enc)
+	return err
+}
+
+// readStanza reads one stanza, returning it along with the raw bytes it
+// occupied (so callers can fold them into a running header MAC).
+func readStanza(br *bufio.Reader) (st Stanza, raw []byte, err error) {
+	var buf bytes.Buffer
+
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return
+	}
+	buf.WriteString(line)
+
+	fields := strings.Fields(strings.TrimSuffix(line, "\n"))
+	if len(fields) < 2 || fields[0] != "->" {
+		err = fmt.Errorf("expected a stanza header line, got %q", line)
+		return
+	}
+	st = Stanza{Type: fields[1], Args: fields[2:]}
+
+	// A body line's length can't tell us whether it's the last one: a
+	// Recipient whose wrapped body happens to base64-encode to an exact
+	// multiple of 64 chars writes its final line at exactly 64 chars,
+	// indistinguishable by length from a continuation line. Terminate on
+	// the next stanza or trailer marker instead, the same way armor.go's
+	// reader looks for the "=crc" line rather than counting line lengths.
+	var bodyB64 strings.Builder
+	for {
+		if peeked, perr := br.Peek(4); perr == nil && (string(peeked[:3]) == "-> " || string(peeked) == "--- ") {
+			break
+		}
+		var bline string
+		bline, err = br.ReadString('\n')
+		if err != nil {
+			return
+		}
+		buf.WriteString(bline)
+		bodyB64.WriteString(strings.TrimSuffix(bline, "\n"))
+	}
+
+	st.Body, err = base64.StdEncoding.DecodeString(bodyB64.String())
+	if err != nil {
+		err = fmt.Errorf("bad stanza body encoding: %w", err)
+		return
+	}
+	raw = buf.Bytes()
+	return
+}
+
+// nameSubkey derives a Spritz state used only to encrypt/decrypt the
+// stored filename, kept separate from headerMAC's state and from the
+// per-chunk payload subkeys (chunkSubkey) by absorbing a dedicated
+// constant alongside the file key.
+func nameSubkey(fileKey []byte) *state {
+	s := new(state)
+	initialize(s)
+	absorbMany(s, fileKey)
+	absorbStop(s)
+	absorbMany(s, []byte("filename"))
+	absorbStop(s)
+	return s
+}
+
+// headerMAC authenticates a multi-recipient header under the (now
+// recovered) file key, so a recipient stanza can't be added, removed, or
+// swapped without detection once decryption is attempted.
+func headerMAC(fileKey, header []byte) []byte {
+	s := new(state)
+	initialize(s)
+	absorbMany(s, fileKey)
+	absorbStop(s)
+	absorbMany(s, header)
+	absorbStop(s)
+	mac := make([]byte, tagSize)
+	dripMany(s, mac)
+	return mac
+}
@@ -0,0 +1,116 @@
+package spritz
+
+// ---------------------------------------
+// A password Recipient/Identity, using scrypt in place of the
+// hand-rolled iterated Sum() stretching that newStream/WrapWriter use.
+// ---------------------------------------
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const scryptStanzaType = "scrypt"
+
+// DefaultScryptLogN is the default scrypt work factor (N = 1<<LogN) used
+// by NewScryptRecipient.
+const DefaultScryptLogN = 18
+
+// maxScryptLogN bounds the work factor UnwrapStanza will honor from a
+// stanza. N = 1<<30 asks scrypt to allocate around 1 TiB and crashes the
+// process outright, so an attacker-supplied stanza could use an
+// unbounded LogN as a one-shot DoS against anyone decrypting it with a
+// password identity; 20 is already well above DefaultScryptLogN.
+const maxScryptLogN = 20
+
+// ScryptRecipient wraps a file key under a password. Each call to
+// WrapFileKey draws a fresh random salt, so encrypting the same file key
+// to the same password twice produces different stanzas.
+type ScryptRecipient struct {
+	Password string
+	LogN     uint8 // scrypt N = 1<<LogN
+}
+
+// NewScryptRecipient builds a ScryptRecipient using DefaultScryptLogN.
+func NewScryptRecipient(password string) *ScryptRecipient {
+	return &ScryptRecipient{Password: password, LogN: DefaultScryptLogN}
+}
+
+// WrapFileKey implements Recipient.
+func (r *ScryptRecipient) WrapFileKey(fileKey []byte) (Stanza, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return Stanza{}, err
+	}
+
+	wrap, err := scryptWrapKey(r.Password, salt, r.LogN)
+	if err != nil {
+		return Stanza{}, err
+	}
+
+	wrapped := make([]byte, len(fileKey))
+	for i := range fileKey {
+		wrapped[i] = fileKey[i] ^ wrap[i]
+	}
+
+	return Stanza{
+		Type: scryptStanzaType,
+		Args: []string{base64.RawStdEncoding.EncodeToString(salt), strconv.Itoa(int(r.LogN))},
+		Body: wrapped,
+	}, nil
+}
+
+// scryptIdentity unwraps a stanza produced by a ScryptRecipient sharing
+// the same password.
+type scryptIdentity struct {
+	password string
+}
+
+// NewScryptIdentity builds an Identity that tries to unwrap scrypt
+// stanzas with the given password.
+func NewScryptIdentity(password string) Identity {
+	return &scryptIdentity{password: password}
+}
+
+// UnwrapStanza implements Identity.
+func (id *scryptIdentity) UnwrapStanza(st Stanza) ([]byte, error) {
+	if st.Type != scryptStanzaType || len(st.Args) != 2 {
+		return nil, fmt.Errorf("spritz: not a scrypt stanza")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(st.Args[0])
+	if err != nil {
+		return nil, fmt.Errorf("spritz: bad scrypt salt")
+	}
+
+	logN, err := strconv.Atoi(st.Args[1])
+	if err != nil || logN < 1 || logN > maxScryptLogN {
+		return nil, fmt.Errorf("spritz: bad scrypt work factor")
+	}
+
+	if len(st.Body) != fileKeySize {
+		return nil, fmt.Errorf("spritz: bad scrypt stanza body")
+	}
+
+	wrap, err := scryptWrapKey(id.password, salt, uint8(logN))
+	if err != nil {
+		return nil, err
+	}
+
+	fileKey := make([]byte, fileKeySize)
+	for i := range fileKey {
+		fileKey[i] = st.Body[i] ^ wrap[i]
+	}
+	return fileKey, nil
+}
+
+// scryptWrapKey derives a fileKeySize-byte wrapping key from a password
+// and salt using scrypt, with r=8 and p=1 as recommended for interactive
+// use.
+func scryptWrapKey(password string, salt []byte, logN uint8) ([]byte, error) {
+	return scrypt.Key([]byte(password), salt, 1<<logN, 8, 1, fileKeySize)
+}
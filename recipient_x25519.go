@@ -0,0 +1,131 @@
+package spritz
+
+// ---------------------------------------
+// An X25519 public-key Recipient/Identity: an ephemeral-static ECDH
+// exchange, with the shared secret expanded into a wrapping key by
+// Spritz's own Sum() acting as the PRF.
+// ---------------------------------------
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+const x25519StanzaType = "X25519"
+
+// X25519Recipient wraps a file key to a recipient's X25519 public key.
+// Each call to WrapFileKey generates a fresh ephemeral key pair, so the
+// sender never needs (or has) a static private key of their own.
+type X25519Recipient struct {
+	PublicKey [32]byte
+}
+
+// NewX25519Recipient builds an X25519Recipient for the given public key.
+func NewX25519Recipient(pub [32]byte) *X25519Recipient {
+	return &X25519Recipient{PublicKey: pub}
+}
+
+// WrapFileKey implements Recipient.
+func (r *X25519Recipient) WrapFileKey(fileKey []byte) (Stanza, error) {
+	var ephPriv, ephPub [32]byte
+	if _, err := rand.Read(ephPriv[:]); err != nil {
+		return Stanza{}, err
+	}
+	curve25519.ScalarBaseMult(&ephPub, &ephPriv)
+
+	var shared [32]byte
+	curve25519.ScalarMult(&shared, &ephPriv, &r.PublicKey)
+	if isZero(shared[:]) {
+		return Stanza{}, fmt.Errorf("spritz: X25519 shared secret is zero (low-order public key?)")
+	}
+
+	wrap := x25519WrapKey(shared[:], ephPub[:], r.PublicKey[:])
+
+	wrapped := make([]byte, len(fileKey))
+	for i := range fileKey {
+		wrapped[i] = fileKey[i] ^ wrap[i]
+	}
+
+	return Stanza{
+		Type: x25519StanzaType,
+		Args: []string{base64.RawStdEncoding.EncodeToString(ephPub[:])},
+		Body: wrapped,
+	}, nil
+}
+
+// X25519Identity unwraps a stanza produced by an X25519Recipient holding
+// the matching public key.
+type X25519Identity struct {
+	PrivateKey [32]byte
+}
+
+// NewX25519Identity builds an X25519Identity for the given private key.
+func NewX25519Identity(priv [32]byte) *X25519Identity {
+	return &X25519Identity{PrivateKey: priv}
+}
+
+// UnwrapStanza implements Identity.
+func (id *X25519Identity) UnwrapStanza(st Stanza) ([]byte, error) {
+	if st.Type != x25519StanzaType || len(st.Args) != 1 {
+		return nil, fmt.Errorf("spritz: not an X25519 stanza")
+	}
+
+	ephPub, err := base64.RawStdEncoding.DecodeString(st.Args[0])
+	if err != nil || len(ephPub) != 32 {
+		return nil, fmt.Errorf("spritz: bad X25519 ephemeral key")
+	}
+
+	if len(st.Body) != fileKeySize {
+		return nil, fmt.Errorf("spritz: bad X25519 stanza body")
+	}
+
+	var pub [32]byte
+	curve25519.ScalarBaseMult(&pub, &id.PrivateKey)
+
+	var ephPubArr [32]byte
+	copy(ephPubArr[:], ephPub)
+
+	var shared [32]byte
+	curve25519.ScalarMult(&shared, &id.PrivateKey, &ephPubArr)
+	if isZero(shared[:]) {
+		return nil, fmt.Errorf("spritz: X25519 shared secret is zero (low-order ephemeral key?)")
+	}
+
+	wrap := x25519WrapKey(shared[:], ephPub, pub[:])
+
+	fileKey := make([]byte, fileKeySize)
+	for i := range fileKey {
+		fileKey[i] = st.Body[i] ^ wrap[i]
+	}
+	return fileKey, nil
+}
+
+// isZero reports whether b is all-zero, which curve25519.ScalarMult
+// returns for a low-order (or otherwise degenerate) public key. Using
+// such a shared secret would let an attacker-supplied public key force a
+// fixed, attacker-known wrapping key regardless of either party's real
+// private key, so it must be rejected rather than fed to x25519WrapKey
+// (the same check age makes for exactly this reason).
+func isZero(b []byte) bool {
+	var v byte
+	for _, x := range b {
+		v |= x
+	}
+	return subtle.ConstantTimeByteEq(v, 0) == 1
+}
+
+// x25519WrapKey expands an ECDH shared secret into a fileKeySize-byte
+// wrapping key, binding in the ephemeral and recipient public keys as
+// context so the same shared secret can never be replayed against a
+// different recipient or stanza.
+func x25519WrapKey(shared, ephPub, recipientPub []byte) []byte {
+	info := make([]byte, 0, len(shared)+len(ephPub)+len(recipientPub))
+	info = append(info, shared...)
+	info = append(info, ephPub...)
+	info = append(info, recipientPub...)
+	return Sum(fileKeySize*8, info)
+}
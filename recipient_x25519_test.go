@@ -0,0 +1,60 @@
+package spritz
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+func TestX25519RecipientRoundTrip(t *testing.T) {
+	var priv, pub [32]byte
+	if _, err := rand.Read(priv[:]); err != nil {
+		t.Fatalf("generating private key: %v", err)
+	}
+	curve25519.ScalarBaseMult(&pub, &priv)
+
+	r := NewX25519Recipient(pub)
+	id := NewX25519Identity(priv)
+
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		t.Fatalf("generating file key: %v", err)
+	}
+
+	st, err := r.WrapFileKey(fileKey)
+	if err != nil {
+		t.Fatalf("WrapFileKey: %v", err)
+	}
+
+	got, err := id.UnwrapStanza(st)
+	if err != nil {
+		t.Fatalf("UnwrapStanza: %v", err)
+	}
+	if string(got) != string(fileKey) {
+		t.Fatalf("got file key %x, want %x", got, fileKey)
+	}
+}
+
+// TestX25519RejectsZeroSharedSecret uses the all-zero point, a low-order
+// point on curve25519: ECDH against it always yields an all-zero shared
+// secret, no matter the other party's private key. WrapFileKey and
+// UnwrapStanza must refuse to derive a wrapping key from it.
+func TestX25519RejectsZeroSharedSecret(t *testing.T) {
+	var lowOrder [32]byte
+
+	r := NewX25519Recipient(lowOrder)
+	if _, err := r.WrapFileKey(make([]byte, fileKeySize)); err == nil {
+		t.Fatal("expected WrapFileKey to reject a zero shared secret, got nil error")
+	}
+
+	id := NewX25519Identity(lowOrder)
+	st := Stanza{
+		Type: x25519StanzaType,
+		Args: []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"},
+		Body: make([]byte, fileKeySize),
+	}
+	if _, err := id.UnwrapStanza(st); err == nil {
+		t.Fatal("expected UnwrapStanza to reject a zero shared secret, got nil error")
+	}
+}
@@ -144,7 +144,7 @@ func readHeader(src io.Reader, firstByte byte, pw string) (rdr io.Reader, fn str
 	}
 
 	// check the version number and hash match
-	if (remaining[0] != 2) ||
+	if (remaining[0] != 2 && remaining[0] != 3) ||
 		(!bytes.Equal(remaining[1:5], Sum(32, rbytes))) {
 		err = fmt.Errorf("Bad pw or corrupted file!")
 		return
@@ -160,6 +160,10 @@ func readHeader(src io.Reader, firstByte byte, pw string) (rdr io.Reader, fn str
 		fn = string(decnBytes)
 	}
 
+	if remaining[0] == 3 {
+		rdr = newAEADReader(src, deriveFileKey(tmp256, iv), DefaultChunkSize)
+	}
+
 	return
 }
 